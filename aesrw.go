@@ -16,12 +16,24 @@ import (
 
 /**
  * Satisfies the Reader interfaces. Able to read data from an io.Reader
- * that was written with AESWriter.
+ * that was written with AESWriter. Read never blocks waiting for more
+ * ciphertext than a single AES block: it issues one Read on the
+ * underlying stream, decrypts whatever complete blocks came back, and
+ * holds the most recent block back as a candidate final block until
+ * either more data arrives (proving it wasn't final) or the stream
+ * genuinely ends.
  */
 type AESReader struct {
 	//Data stream to read from
-	ds *bufio.Reader
-	//Handles data which doesn't fit to chunk size
+	ds io.Reader
+	//Ciphertext bytes read but not yet a complete block
+	partial []byte
+	//Most recently completed ciphertext block, held back because it
+	//might be the final, padded block; empty once confirmed otherwise
+	held []byte
+	//Set once ds has reported a genuine io.EOF
+	eof bool
+	//Decrypted plaintext waiting to be copied out by Read
 	nRem int
 	rem []byte
 	//For performing decryption of the data
@@ -222,80 +234,114 @@ func NewReader(r io.Reader, k []byte) (*AESReader, error) {
 		return nil, errors.New("Key must be of length 16, 24, or 32.")
 	}
 	tmpBlock := make([]byte, aes.BlockSize)
-	//Needed to peek on the input stream in Read
-	br := bufio.NewReader(r)
 	//Read the IV from the stream
-	nr, err := io.ReadFull(br, tmpBlock)
+	nr, err := io.ReadFull(r, tmpBlock)
 	if nr != aes.BlockSize || err != nil {
 		return nil, err
 	}
 	//Create a new block cipher from the key and IV
 	blk, err := aes.NewCipher(k)
 	mde := cipher.NewCBCDecrypter(blk, tmpBlock)
-	return &AESReader{ds: br, rem: make([]byte, aes.BlockSize), block: blk, mode: mde}, nil
+	return &AESReader{ds: r, block: blk, mode: mde}, nil
 }
 
 /**
  * Read and decrypt data from the underlying io.Reader that was
- * encrypted using an AESWriter.
+ * encrypted using an AESWriter. At most one Read is issued on the
+ * underlying stream per call, so this returns as soon as any data is
+ * available rather than blocking until len(b) bytes can be produced.
+ * The final, padded ciphertext block is held back internally until
+ * the underlying stream's genuine EOF confirms it really is the last
+ * block, rather than probing ahead with Peek.
  */
 func (r *AESReader) Read(b []byte) (n int, err error) {
-	//Buffer has no capacity
-	if cap(b) <= 0 {
+	if len(b) <= 0 {
 		return 0, nil
 	}
-	//Still have r.nRem bytes; determine total number of bytes to read to fill buffer
-	roundSize := ((len(b) - r.nRem) / aes.BlockSize) * aes.BlockSize
-	if ((len(b) - r.nRem) % aes.BlockSize) > 0 {
-		roundSize += aes.BlockSize
+	//Serve any data that was decrypted on a previous call first; this
+	//alone can satisfy the call without touching the underlying stream
+	n = copy(b, r.rem[0:r.nRem])
+	copy(r.rem, r.rem[n:])
+	r.nRem -= n
+	if n > 0 {
+		return n, nil
 	}
-	//Copy any data that was decrypted previously
-	nr := copy(b, r.rem[0:r.nRem])
-	//Update the remainder variabales
-	copy(r.rem, r.rem[nr:])
-	r.nRem -= nr
-	if roundSize > 0 {	//Only necessary if buffer wasn't filled yet
-		//Need to read and decode another chunk to fill b
-		buf := make([]byte, roundSize)
-		n, err = io.ReadFull(r.ds, buf)
-		//Data was read but didn't fill roundSize; this might be okay
-		if err == io.ErrUnexpectedEOF && n > 0 {
-			err = nil	//Supress the error
-		} else if (err == io.EOF && n == 0) {
-			return nr, err //Valid EOF detected; notify caller end was reached
-		} else if err != nil {
-			return nr, err //Some other error occured
-		}
-		//Perform the decryption; valid stream will be a multiple of block length
-		if n % aes.BlockSize != 0 {
-			return nr, errors.New("Stream is not a valid AESRW stream.")
-		}
-		r.mode.CryptBlocks(buf[0:n], buf[0:n])
-		//If stream is valid it will be a multiple of block size so this
-		//effectively tests if another block is present
-		_, err = r.ds.Peek(1)
-		if err != nil {
-			//Last block read contains padding that must be removed
-			//Last byte indicates the amount of padding added by AESWriter
-			nPad := int(buf[n - 1])
-			n -= nPad
+	if r.eof {
+		return 0, io.EOF
+	}
+	//Room left in b for newly read blocks once r.held (if any) is
+	//emitted as plaintext this round too
+	room := len(b) - len(r.held)
+	if room < 0 {
+		room = 0
+	}
+	newCt := ((room + aes.BlockSize - 1) / aes.BlockSize) * aes.BlockSize
+	//Single, non-blocking-as-possible read of whatever ciphertext is
+	//currently available on the underlying stream; one extra block is
+	//requested to have a new candidate final block to hold back
+	buf := make([]byte, len(r.partial)+newCt+aes.BlockSize)
+	nc := copy(buf, r.partial)
+	nr, rerr := r.ds.Read(buf[nc:])
+	nc += nr
+	if rerr != nil && rerr != io.EOF {
+		return 0, rerr
+	}
+	//Split off whatever doesn't yet complete a block; it's carried
+	//over to the next call
+	nBlocks := nc / aes.BlockSize
+	r.partial = append(r.partial[:0], buf[nBlocks*aes.BlockSize:nc]...)
+	complete := buf[0 : nBlocks*aes.BlockSize]
+	if rerr != io.EOF {
+		//More data may still arrive; only the blocks before the final
+		//one read can safely be decrypted, since the last one read is
+		//held back as a candidate for the final, padded block
+		if len(r.held) > 0 {
+			r.mode.CryptBlocks(r.held, r.held)
+			n = copy(b, r.held)
+			r.rem = append(r.rem[:0], r.held[n:]...)
+			r.nRem = len(r.rem)
+			r.held = nil
 		}
-		//Test if invalid padding value was supplied
-		if n > len(buf) || n < 0 {
-			return nr, errors.New("Stream is not a valid AESRW stream.")
+		if len(complete) > 0 {
+			r.held = append([]byte{}, complete[len(complete)-aes.BlockSize:]...)
+			complete = complete[0 : len(complete)-aes.BlockSize]
 		}
-		buf = buf[0:n]
-		//Copy enough data to fill b after any remainder from above
-		ar := copy(b[nr:], buf)
-		nr += ar
-		//Buffer any remainder to next call
-		r.nRem = copy(r.rem, buf[ar:])
-		//If there is still a remainder left; suppress EOF error
-		if r.nRem > 0 {
-			err = nil
+		if len(complete) > 0 {
+			r.mode.CryptBlocks(complete, complete)
+			served := copy(b[n:], complete)
+			n += served
+			if served < len(complete) {
+				r.rem = append(r.rem[:r.nRem], complete[served:]...)
+				r.nRem += len(complete) - served
+			}
 		}
+		return n, nil
+	}
+	//Genuine EOF: r.held plus every remaining complete block forms the
+	//rest of the stream, and the very last block carries the padding
+	if len(r.partial) != 0 {
+		return n, errors.New("Stream is not a valid AESRW stream.")
+	}
+	final := append(r.held, complete...)
+	r.held = nil
+	r.eof = true
+	if len(final) == 0 || len(final)%aes.BlockSize != 0 {
+		return n, errors.New("Stream is not a valid AESRW stream.")
+	}
+	r.mode.CryptBlocks(final, final)
+	nPad := int(final[len(final)-1])
+	if nPad <= 0 || nPad > aes.BlockSize || nPad > len(final) {
+		return n, errors.New("Stream is not a valid AESRW stream.")
+	}
+	final = final[0 : len(final)-nPad]
+	ar := copy(b[n:], final)
+	n += ar
+	r.rem = append(r.rem[:0], final[ar:]...)
+	r.nRem = len(r.rem)
+	if n == 0 {
+		return 0, io.EOF
 	}
-	return nr, err
+	return n, nil
 }
 
 //Returns max of 2 ints
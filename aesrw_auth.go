@@ -0,0 +1,320 @@
+package aesrw
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/poly1305"
+)
+
+//ErrAuthFailed is returned by AESAuthReader.Read when the trailing
+//Poly1305-AES tag does not match the tag computed over the ciphertext.
+//Unlike a padding error this indicates the stream was tampered with;
+//any plaintext already returned by earlier Read calls should be
+//discarded by the caller.
+var ErrAuthFailed = errors.New("aesrw: authentication failed")
+
+//Size in bytes of the Poly1305-AES portion of the key accepted by
+//NewAuthWriter/NewAuthReader: 16 bytes for the nonce cipher (k) plus
+//16 bytes for the Poly1305 r value.
+const authMacKeySize = 32
+
+/**
+ * Satisfies the Writer interfaces. Like AESWriter but additionally
+ * authenticates the ciphertext with a Poly1305-AES MAC.
+ * Note: Close() must be called in order to finalize the data stream
+ * and write the trailing tag.
+ */
+type AESAuthWriter struct {
+	//Data stream to write to
+	ds io.Writer
+	//Handles data which doesn't fit to chunk size
+	nRem int
+	rem  []byte
+	//For performing encryption of the data
+	block cipher.Block
+	mode  cipher.BlockMode
+	//Accumulates the Poly1305-AES tag over the IV and ciphertext
+	mac *poly1305.MAC
+}
+
+/**
+ * Satisfies the Reader interfaces. Able to read data from an io.Reader
+ * that was written with AESAuthWriter, verifying the trailing MAC tag
+ * before signalling a valid EOF.
+ */
+type AESAuthReader struct {
+	//Data stream to read from
+	ds *bufio.Reader
+	//Handles data which doesn't fit to chunk size
+	nRem int
+	rem  []byte
+	//For performing decryption of the data
+	block cipher.Block
+	mode  cipher.BlockMode
+	//Accumulates the Poly1305-AES tag over the IV and ciphertext
+	mac *poly1305.MAC
+	//Holds back the two most recently read blocks, since the stream
+	//always ends in [..final, padded ciphertext block, tag], and a
+	//single block of lookahead can't tell the final ciphertext block
+	//apart from the tag that follows it
+	pendA, pendB []byte
+	//Set once a valid or invalid EOF has been observed
+	eof bool
+}
+
+/**
+ * Splits an extended key into the AES data key and the raw Poly1305-AES
+ * MAC key material (k || r, 32 bytes). Extended keys are 48, 56 or 64
+ * bytes, i.e. a 16/24/32-byte AES key plus the 32-byte MAC key.
+ */
+func splitAuthKey(k []byte) (dataKey, macKey []byte, err error) {
+	if len(k) != 16+authMacKeySize && len(k) != 24+authMacKeySize && len(k) != 32+authMacKeySize {
+		return nil, nil, errors.New("Key must be of length 48, 56, or 64.")
+	}
+	n := len(k) - authMacKeySize
+	return k[0:n], k[n:], nil
+}
+
+/**
+ * Applies the standard Poly1305 clamp to a 16-byte r value, masking
+ * off the bits Poly1305-AES requires to be zero.
+ */
+func poly1305Clamp(r []byte) []byte {
+	c := make([]byte, 16)
+	copy(c, r)
+	c[3] &= 15
+	c[7] &= 15
+	c[11] &= 15
+	c[15] &= 15
+	c[4] &= 252
+	c[8] &= 252
+	c[12] &= 252
+	return c
+}
+
+/**
+ * Derives the 32-byte Poly1305 key (r || AES_k(nonce)) used to
+ * authenticate a single message, per the Poly1305-AES construction.
+ */
+func derivePolyKey(macKey, nonce []byte) (*[32]byte, error) {
+	macBlock, err := aes.NewCipher(macKey[0:16])
+	if err != nil {
+		return nil, err
+	}
+	var key [32]byte
+	copy(key[0:16], poly1305Clamp(macKey[16:32]))
+	macBlock.Encrypt(key[16:32], nonce)
+	return &key, nil
+}
+
+/**
+ * Initialize a new AESAuthWriter. Generates a random IV and a random
+ * Poly1305-AES nonce and writes both to the stream ahead of the
+ * ciphertext. The key must be an AES key followed by a 32-byte
+ * Poly1305-AES MAC key (48, 56 or 64 bytes total).
+ */
+func NewAuthWriter(w io.Writer, k []byte) (*AESAuthWriter, error) {
+	dataKey, macKey, err := splitAuthKey(k)
+	if err != nil {
+		return nil, err
+	}
+	//First block is the CBC IV; generate and write it to the stream
+	iv := make([]byte, aes.BlockSize)
+	if _, err = rand.Reader.Read(iv); err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(iv); err != nil {
+		return nil, err
+	}
+	//Second block is the Poly1305-AES nonce; it is written in the
+	//clear and is not itself covered by the MAC
+	nonce := make([]byte, aes.BlockSize)
+	if _, err = rand.Reader.Read(nonce); err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(nonce); err != nil {
+		return nil, err
+	}
+	polyKey, err := derivePolyKey(macKey, nonce)
+	if err != nil {
+		return nil, err
+	}
+	mac := poly1305.New(polyKey)
+	mac.Write(iv)
+	blk, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	mde := cipher.NewCBCEncrypter(blk, iv)
+	return &AESAuthWriter{ds: w, rem: make([]byte, aes.BlockSize), block: blk, mode: mde, mac: mac}, nil
+}
+
+/**
+ * Finalizes the data stream: pads and encrypts the final block,
+ * folds it into the MAC, and appends the 16-byte Poly1305-AES tag.
+ * This must be called before the data stream is complete.
+ */
+func (w *AESAuthWriter) Close() error {
+	//w.nRem should be less than one block in length
+	nPad := aes.BlockSize - w.nRem
+	for i := w.nRem; i < len(w.rem); i++ {
+		w.rem[i] = byte(nPad)
+	}
+	w.mode.CryptBlocks(w.rem, w.rem)
+	w.mac.Write(w.rem)
+	w.ds.Write(w.rem)
+	w.ds.Write(w.mac.Sum(nil))
+	w.nRem = 0
+	return nil
+}
+
+/**
+ * Write data to the underlying io.Writer. Data is written in chunks,
+ * MACed as ciphertext is produced, and any extra is buffered between
+ * calls.
+ */
+func (w *AESAuthWriter) Write(b []byte) (nw int, err error) {
+	if len(b) <= 0 {
+		return 0, nil
+	}
+	//The amount that will actually be written including any existing remainder
+	roundSize := ((len(b) + w.nRem) / aes.BlockSize) * aes.BlockSize
+	//Actual amount of b to actually write on this call
+	nbw := Max(roundSize-w.nRem, 0)
+	if roundSize > 0 { //Prevent any index out of bounds errors
+		//Temporary buffer capable of holding remainder plus data from b
+		buf := make([]byte, roundSize)
+		//Copy any remaining data to temp buffer
+		copy(buf, w.rem[0:w.nRem])
+		//Copy the data passed on this call
+		copy(buf[w.nRem:], b[0:nbw])
+		//There is no remainder at this point
+		w.nRem = 0
+		//Encrypt, MAC and write the buffer
+		w.mode.CryptBlocks(buf, buf)
+		w.mac.Write(buf)
+		w.ds.Write(buf)
+	}
+	//Keep track of remainder from this call
+	copy(w.rem[w.nRem:], b[nbw:])
+	w.nRem += (len(b) - nbw)
+	return len(b), nil
+}
+
+/**
+ * Create a new AESAuthReader, reading the IV and Poly1305-AES nonce
+ * from the stream and deriving the per-message MAC key.
+ */
+func NewAuthReader(r io.Reader, k []byte) (*AESAuthReader, error) {
+	dataKey, macKey, err := splitAuthKey(k)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(r)
+	iv := make([]byte, aes.BlockSize)
+	if nr, err := io.ReadFull(br, iv); nr != aes.BlockSize || err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aes.BlockSize)
+	if nr, err := io.ReadFull(br, nonce); nr != aes.BlockSize || err != nil {
+		return nil, err
+	}
+	polyKey, err := derivePolyKey(macKey, nonce)
+	if err != nil {
+		return nil, err
+	}
+	mac := poly1305.New(polyKey)
+	mac.Write(iv)
+	blk, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	mde := cipher.NewCBCDecrypter(blk, iv)
+	return &AESAuthReader{ds: br, rem: make([]byte, aes.BlockSize), block: blk, mode: mde, mac: mac}, nil
+}
+
+/**
+ * Read and decrypt data from the underlying io.Reader that was
+ * encrypted using an AESAuthWriter. The trailing 16-byte tag is
+ * buffered until the final ciphertext block is identified and is
+ * verified in constant time before a valid io.EOF is returned; on
+ * mismatch ErrAuthFailed is returned instead of io.EOF.
+ */
+func (r *AESAuthReader) Read(b []byte) (n int, err error) {
+	if len(b) <= 0 {
+		return 0, nil
+	}
+	//Serve any data that was decrypted previously
+	n = copy(b, r.rem[0:r.nRem])
+	copy(r.rem, r.rem[n:])
+	r.nRem -= n
+	if r.eof {
+		if n == 0 {
+			return 0, io.EOF
+		}
+		return n, nil
+	}
+	for n < len(b) {
+		next := make([]byte, aes.BlockSize)
+		got, rerr := io.ReadFull(r.ds, next)
+		if got == aes.BlockSize {
+			if r.pendA == nil {
+				r.pendA = next
+			} else if r.pendB == nil {
+				r.pendB = next
+			} else {
+				//A third block arrived, so pendA is confirmed to be a
+				//full ciphertext block and not the final one
+				r.mac.Write(r.pendA)
+				r.mode.CryptBlocks(r.pendA, r.pendA)
+				cp := copy(b[n:], r.pendA)
+				n += cp
+				if cp < len(r.pendA) {
+					r.nRem = copy(r.rem, r.pendA[cp:])
+				}
+				r.pendA = r.pendB
+				r.pendB = next
+			}
+			continue
+		}
+		if rerr != io.EOF && rerr != io.ErrUnexpectedEOF {
+			return n, rerr
+		}
+		//Stream ended; the two held-back blocks plus whatever partial
+		//bytes were read here must together form the final ciphertext
+		//block followed by the 16-byte tag
+		tail := append(append(append([]byte{}, r.pendA...), r.pendB...), next[0:got]...)
+		if len(tail) != aes.BlockSize+poly1305.TagSize {
+			return n, errors.New("Stream is not a valid AESRW stream.")
+		}
+		final, tag := tail[0:aes.BlockSize], tail[aes.BlockSize:]
+		r.mac.Write(final)
+		if subtle.ConstantTimeCompare(r.mac.Sum(nil), tag) != 1 {
+			r.eof = true
+			return n, ErrAuthFailed
+		}
+		r.mode.CryptBlocks(final, final)
+		nPad := int(final[aes.BlockSize-1])
+		if nPad <= 0 || nPad > aes.BlockSize {
+			return n, errors.New("Stream is not a valid AESRW stream.")
+		}
+		final = final[0 : aes.BlockSize-nPad]
+		cp := copy(b[n:], final)
+		n += cp
+		if cp < len(final) {
+			r.nRem = copy(r.rem, final[cp:])
+		}
+		r.eof = true
+		break
+	}
+	if r.eof && n == 0 && r.nRem == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,73 @@
+package aesrw
+
+import "bytes"
+import "io"
+import "math/rand"
+import "testing"
+
+//Generate a random extended key (AES key + 32-byte Poly1305-AES key)
+//of total length n
+func RandomAuthKey(n int) []byte {
+	return RandomBytes(n)
+}
+
+//Test generating random data, encrypting and decrypting it with the
+//authenticated mode, and verifying the result matches the start
+func TestAuthRoundTrip(t *testing.T) {
+	var keyLen = []int{48, 56, 64}
+	for i := 0; i < 200; i++ {
+		k := RandomAuthKey(keyLen[i%len(keyLen)])
+		b1 := RandomBytes(rand.Int() % MAXL)
+		outBuf := new(bytes.Buffer)
+		aw, err := NewAuthWriter(outBuf, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = aw.Write(b1); err != nil {
+			t.Fatal(err)
+		}
+		if err = aw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		ar, err := NewAuthReader(outBuf, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b2 := new(bytes.Buffer)
+		if _, err = io.Copy(b2, ar); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b1, b2.Bytes()) {
+			t.Error("Original and decrypted data do not match!")
+		}
+	}
+}
+
+//Test that flipping a ciphertext byte is detected as a MAC failure
+//rather than silently producing corrupted plaintext
+func TestAuthTamperDetected(t *testing.T) {
+	k := RandomAuthKey(48)
+	b1 := RandomBytes(100)
+	outBuf := new(bytes.Buffer)
+	aw, err := NewAuthWriter(outBuf, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = aw.Write(b1); err != nil {
+		t.Fatal(err)
+	}
+	if err = aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	enc := outBuf.Bytes()
+	//Flip a byte in the final ciphertext block, just ahead of the tag
+	enc[len(enc)-20] ^= 0xff
+	ar, err := NewAuthReader(bytes.NewReader(enc), k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.Copy(new(bytes.Buffer), ar)
+	if err != ErrAuthFailed {
+		t.Error("Tampered stream was not detected as a MAC failure")
+	}
+}
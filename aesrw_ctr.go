@@ -0,0 +1,197 @@
+package aesrw
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+//Mode identifies which block mode a stream produced by EncryptMode was
+//written with; it is stored as a single leading byte so DecryptMode
+//can select the matching cipher.Stream without the caller having to
+//remember which mode was used.
+type Mode byte
+
+const (
+	//ModeCBC is the original padded cipher.BlockMode stream (AESWriter/AESReader)
+	ModeCBC Mode = iota
+	//ModeCTR is the unauthenticated, unpadded stream cipher mode (AESCTRWriter/AESCTRReader)
+	ModeCTR
+)
+
+/**
+ * Satisfies the Writer interfaces. Writes AES-CTR encrypted data to an
+ * io.Writer. Unlike AESWriter there is no block padding, so Close() is
+ * a no-op and is provided only to satisfy io.Closer.
+ */
+type AESCTRWriter struct {
+	//Data stream to write to
+	ds io.Writer
+	//For performing encryption of the data
+	stream cipher.Stream
+}
+
+/**
+ * Satisfies the Reader interfaces. Reads data from an io.Reader that
+ * was written with AESCTRWriter.
+ */
+type AESCTRReader struct {
+	//Data stream to read from
+	ds io.Reader
+	//For performing decryption of the data
+	stream cipher.Stream
+}
+
+/**
+ * Initialize a new AESCTRWriter, generate an IV and write it to
+ * the stream.
+ */
+func NewCTRWriter(w io.Writer, k []byte) (*AESCTRWriter, error) {
+	//Key must be of length 16, 24 or 32 bytes
+	if len(k) != 16 && len(k) != 24 && len(k) != 32 {
+		return nil, errors.New("Key must be of length 16, 24, or 32.")
+	}
+	//First block is IV; generate random IV and write to stream
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Reader.Read(iv); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(iv); err != nil {
+		return nil, err
+	}
+	blk, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return &AESCTRWriter{ds: w, stream: cipher.NewCTR(blk, iv)}, nil
+}
+
+/**
+ * Write data to the underlying io.Writer. CTR mode is a stream cipher
+ * so there is no chunking or buffering; every byte passed in is
+ * written out immediately.
+ */
+func (w *AESCTRWriter) Write(b []byte) (nw int, err error) {
+	if len(b) <= 0 {
+		return 0, nil
+	}
+	buf := make([]byte, len(b))
+	w.stream.XORKeyStream(buf, b)
+	return w.ds.Write(buf)
+}
+
+/**
+ * CTR mode has no trailing block to pad or flush, so Close() does
+ * nothing. It is provided so AESCTRWriter can be used wherever an
+ * io.WriteCloser is expected.
+ */
+func (w *AESCTRWriter) Close() error {
+	return nil
+}
+
+/**
+ * Create a new AESCTRReader and read the IV from the stream.
+ */
+func NewCTRReader(r io.Reader, k []byte) (*AESCTRReader, error) {
+	//Key must be of length 16, 24 or 32 bytes
+	if len(k) != 16 && len(k) != 24 && len(k) != 32 {
+		return nil, errors.New("Key must be of length 16, 24, or 32.")
+	}
+	iv := make([]byte, aes.BlockSize)
+	if nr, err := io.ReadFull(r, iv); nr != aes.BlockSize || err != nil {
+		return nil, err
+	}
+	blk, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return &AESCTRReader{ds: r, stream: cipher.NewCTR(blk, iv)}, nil
+}
+
+/**
+ * Read and decrypt data from the underlying io.Reader that was
+ * encrypted using an AESCTRWriter. Unlike AESReader this never blocks
+ * waiting for a full block: it reads at most len(b) bytes from the
+ * underlying reader and XORs them in place, so EOF is simply the
+ * underlying reader's EOF.
+ */
+func (r *AESCTRReader) Read(b []byte) (n int, err error) {
+	n, err = r.ds.Read(b)
+	if n > 0 {
+		r.stream.XORKeyStream(b[0:n], b[0:n])
+	}
+	return n, err
+}
+
+/**
+ * Perform encryption of a specified byte slice using the given block
+ * mode. The encoded stream carries a one-byte mode tag ahead of the
+ * IV so DecryptMode can pick the matching cipher.Stream. CTR mode is
+ * unauthenticated; pair it with AESAuthWriter/AESAuthReader (see
+ * NewAuthWriter) when tamper detection is required.
+ * @param b	The data to encrypt
+ * @param key	The key to use for encryption
+ * @param mode	The block mode to encrypt with (ModeCBC or ModeCTR)
+ * @return	The encrypted data and any error
+ */
+func EncryptMode(b, key []byte, mode Mode) ([]byte, error) {
+	outBuf := new(bytes.Buffer)
+	if err := outBuf.WriteByte(byte(mode)); err != nil {
+		return nil, err
+	}
+	var aw io.WriteCloser
+	var err error
+	switch mode {
+	case ModeCBC:
+		aw, err = NewWriter(outBuf, key)
+	case ModeCTR:
+		aw, err = NewCTRWriter(outBuf, key)
+	default:
+		return nil, errors.New("Unsupported mode.")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(aw, bytes.NewBuffer(b)); err != nil {
+		return nil, err
+	}
+	if err = aw.Close(); err != nil {
+		return nil, err
+	}
+	return outBuf.Bytes(), nil
+}
+
+/**
+ * Perform decryption of data produced by EncryptMode, auto-selecting
+ * the block mode from the leading mode byte.
+ * @param b	The data to decrypt
+ * @param key	The key to use for decryption
+ * @return	The decrypted data and any error
+ */
+func DecryptMode(b, key []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(b)
+	modeByte, err := buf.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	var ar io.Reader
+	switch Mode(modeByte) {
+	case ModeCBC:
+		ar, err = NewReader(buf, key)
+	case ModeCTR:
+		ar, err = NewCTRReader(buf, key)
+	default:
+		return nil, errors.New("Unsupported mode.")
+	}
+	if err != nil {
+		return nil, err
+	}
+	outBuf := new(bytes.Buffer)
+	if _, err = io.Copy(outBuf, ar); err != nil {
+		return nil, err
+	}
+	return outBuf.Bytes(), nil
+}
@@ -0,0 +1,54 @@
+package aesrw
+
+import "bytes"
+import "math/rand"
+import "testing"
+
+//Test generating random data, encrypting and decrypting it with
+//AESCTRWriter/AESCTRReader, and verifying the result matches the start
+func TestCTRRoundTrip(t *testing.T) {
+	var keyLen = []int{16, 24, 32}
+	for i := 0; i < 200; i++ {
+		k := RandomBytes(keyLen[i%len(keyLen)])
+		b1 := RandomBytes(rand.Int() % MAXL)
+		outBuf := new(bytes.Buffer)
+		cw, err := NewCTRWriter(outBuf, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = cw.Write(b1); err != nil {
+			t.Fatal(err)
+		}
+		cw.Close()
+		cr, err := NewCTRReader(outBuf, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b2 := make([]byte, len(b1))
+		if _, err = cr.Read(b2); err != nil && len(b1) > 0 {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b1, b2) {
+			t.Error("Original and decrypted data do not match!")
+		}
+	}
+}
+
+//Test EncryptMode/DecryptMode round tripping for both supported modes
+func TestEncryptModeRoundTrip(t *testing.T) {
+	k := RandomBytes(32)
+	b1 := RandomBytes(500)
+	for _, mode := range []Mode{ModeCBC, ModeCTR} {
+		enc, err := EncryptMode(b1, k, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec, err := DecryptMode(enc, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b1, dec) {
+			t.Error("Original and decrypted data do not match!")
+		}
+	}
+}
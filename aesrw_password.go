@@ -0,0 +1,192 @@
+package aesrw
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+//Magic header written at the start of every password-encrypted stream,
+//identifying it as an AESRW envelope and fixing the header layout.
+var passwordMagic = []byte("AESRW1")
+
+//saltSize is the length in bytes of the random per-message scrypt salt.
+const saltSize = 16
+
+//kdfScrypt identifies the scrypt KDF in the envelope header. It is the
+//only KDF id currently defined.
+const kdfScrypt = 1
+
+/**
+ * KDFParams controls the scrypt cost parameters used to derive an AES
+ * key from a passphrase. NewWriterFromPassword (and so
+ * EncryptWithPassword) replaces params whose KeyLen is 0, including
+ * the zero value, with DefaultKDFParams().
+ */
+type KDFParams struct {
+	//CPU/memory cost parameter; must be a power of two greater than 1
+	N int
+	//Block size parameter
+	R int
+	//Parallelization parameter
+	P int
+	//Length in bytes of the derived AES key (16, 24 or 32)
+	KeyLen int
+}
+
+/**
+ * DefaultKDFParams returns the scrypt parameters used when none are
+ * supplied: N=32768, r=8, p=1, deriving a 32-byte (AES-256) key.
+ */
+func DefaultKDFParams() KDFParams {
+	return KDFParams{N: 32768, R: 8, P: 1, KeyLen: 32}
+}
+
+/**
+ * Derives an AES key from a passphrase and salt using scrypt under
+ * the given parameters.
+ */
+func deriveKey(passphrase string, salt []byte, params KDFParams) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, params.N, params.R, params.P, params.KeyLen)
+}
+
+/**
+ * Writes the self-describing envelope header (magic, KDF id, scrypt
+ * parameters and salt) that precedes the IV and CBC ciphertext body.
+ */
+func writeHeader(w io.Writer, salt []byte, params KDFParams) error {
+	if _, err := w.Write(passwordMagic); err != nil {
+		return err
+	}
+	hdr := make([]byte, 1+4+4+4+1+len(salt))
+	hdr[0] = kdfScrypt
+	binary.BigEndian.PutUint32(hdr[1:5], uint32(params.N))
+	binary.BigEndian.PutUint32(hdr[5:9], uint32(params.R))
+	binary.BigEndian.PutUint32(hdr[9:13], uint32(params.P))
+	hdr[13] = byte(params.KeyLen)
+	copy(hdr[14:], salt)
+	_, err := w.Write(hdr)
+	return err
+}
+
+/**
+ * Reads and parses the envelope header written by writeHeader,
+ * returning the scrypt parameters and salt needed to re-derive the key.
+ */
+func readHeader(r io.Reader) (KDFParams, []byte, error) {
+	magic := make([]byte, len(passwordMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return KDFParams{}, nil, err
+	}
+	if !bytes.Equal(magic, passwordMagic) {
+		return KDFParams{}, nil, errors.New("aesrw: not a password-encrypted AESRW stream")
+	}
+	hdr := make([]byte, 1+4+4+4+1+saltSize)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return KDFParams{}, nil, err
+	}
+	if hdr[0] != kdfScrypt {
+		return KDFParams{}, nil, errors.New("aesrw: unsupported KDF id")
+	}
+	params := KDFParams{
+		N:      int(binary.BigEndian.Uint32(hdr[1:5])),
+		R:      int(binary.BigEndian.Uint32(hdr[5:9])),
+		P:      int(binary.BigEndian.Uint32(hdr[9:13])),
+		KeyLen: int(hdr[13]),
+	}
+	salt := make([]byte, saltSize)
+	copy(salt, hdr[14:])
+	return params, salt, nil
+}
+
+/**
+ * Perform encryption of a specified byte slice using a passphrase
+ * instead of a raw key. A random salt is generated per call and, along
+ * with the KDF parameters, is written ahead of the IV and ciphertext
+ * so DecryptWithPassword can re-derive the same key.
+ * @param plain		The data to encrypt
+ * @param passphrase	The passphrase to derive the AES key from
+ * @param params	The scrypt cost parameters to use
+ * @return	The encrypted data and any error
+ */
+func EncryptWithPassword(plain []byte, passphrase string, params KDFParams) ([]byte, error) {
+	outBuf := new(bytes.Buffer)
+	aw, err := NewWriterFromPassword(outBuf, passphrase, params)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(aw, bytes.NewBuffer(plain)); err != nil {
+		return nil, err
+	}
+	if err = aw.Close(); err != nil {
+		return nil, err
+	}
+	return outBuf.Bytes(), nil
+}
+
+/**
+ * Perform decryption of data produced by EncryptWithPassword /
+ * NewWriterFromPassword, re-deriving the key from the passphrase and
+ * the KDF parameters stored in the envelope header.
+ * @param enc		The data to decrypt
+ * @param passphrase	The passphrase the data was encrypted with
+ * @return	The decrypted data and any error
+ */
+func DecryptWithPassword(enc []byte, passphrase string) ([]byte, error) {
+	buf := bytes.NewBuffer(enc)
+	ar, err := NewReaderFromPassword(buf, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	outBuf := new(bytes.Buffer)
+	if _, err = io.Copy(outBuf, ar); err != nil {
+		return nil, err
+	}
+	return outBuf.Bytes(), nil
+}
+
+/**
+ * Initialize a new AESWriter whose key is derived from a passphrase.
+ * Writes the magic/KDF header followed by the usual IV, then returns
+ * the underlying AESWriter so the body can be streamed as usual.
+ */
+func NewWriterFromPassword(w io.Writer, passphrase string, params KDFParams) (*AESWriter, error) {
+	if params.KeyLen == 0 {
+		params = DefaultKDFParams()
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Reader.Read(salt); err != nil {
+		return nil, err
+	}
+	if err := writeHeader(w, salt, params); err != nil {
+		return nil, err
+	}
+	key, err := deriveKey(passphrase, salt, params)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriter(w, key)
+}
+
+/**
+ * Create a new AESReader whose key is derived from a passphrase,
+ * parsing the magic/KDF header to recover the salt and scrypt cost
+ * parameters before re-deriving the key and reading the IV.
+ */
+func NewReaderFromPassword(r io.Reader, passphrase string) (*AESReader, error) {
+	br := bufio.NewReader(r)
+	params, salt, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	key, err := deriveKey(passphrase, salt, params)
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(br, key)
+}
@@ -0,0 +1,43 @@
+package aesrw
+
+import "bytes"
+import "math/rand"
+import "testing"
+
+//Use cheap scrypt parameters in tests so they run quickly
+func testKDFParams() KDFParams {
+	return KDFParams{N: 16, R: 1, P: 1, KeyLen: 32}
+}
+
+//Test generating random data, encrypting and decrypting it with a
+//passphrase, and verifying the result matches the start
+func TestPasswordRoundTrip(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		s1 := RandomBytes(rand.Int() % MAXL)
+		pass := RandomString(1 + rand.Int()%32)
+		enc, err := EncryptWithPassword(s1, pass, testKDFParams())
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec, err := DecryptWithPassword(enc, pass)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(s1, dec) {
+			t.Error("Original and decrypted data do not match!")
+		}
+	}
+}
+
+//Test that the wrong passphrase does not reproduce the original data
+func TestPasswordWrongPassphrase(t *testing.T) {
+	s1 := RandomBytes(200)
+	enc, err := EncryptWithPassword(s1, "correct horse battery staple", testKDFParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := DecryptWithPassword(enc, "wrong passphrase")
+	if err == nil && bytes.Equal(s1, dec) {
+		t.Error("Decryption succeeded with the wrong passphrase")
+	}
+}
@@ -0,0 +1,177 @@
+package aesrw
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"io"
+	"math/big"
+)
+
+/**
+ * Satisfies io.ReaderAt and io.Seeker. Wraps an io.ReaderAt holding
+ * data produced by EncryptMode and allows decrypting arbitrary byte
+ * ranges without streaming from offset 0. CTR-mode streams support
+ * fully unaligned random access; CBC-mode streams are decrypted a
+ * block at a time by reading the ciphertext block immediately
+ * preceding the target offset and using it as the CBC IV.
+ *
+ * Note: for CBC streams, ReadAt does not strip the trailing PKCS-style
+ * padding written by AESWriter.Close, since an io.ReaderAt has no
+ * notion of where the stream ends; decrypt the final bytes with an
+ * AESReader instead if the exact plaintext length matters.
+ */
+type AESRandomReader struct {
+	ra      io.ReaderAt
+	mode    Mode
+	block   cipher.Block
+	baseIV  []byte
+	dataOff int64
+	pos     int64
+}
+
+/**
+ * Creates a new AESRandomReader over data produced by EncryptMode: a
+ * leading mode byte, the IV, then the ciphertext body.
+ */
+func NewRandomReader(ra io.ReaderAt, k []byte) (*AESRandomReader, error) {
+	if len(k) != 16 && len(k) != 24 && len(k) != 32 {
+		return nil, errors.New("Key must be of length 16, 24, or 32.")
+	}
+	hdr := make([]byte, 1+aes.BlockSize)
+	if _, err := ra.ReadAt(hdr, 0); err != nil {
+		return nil, err
+	}
+	mode := Mode(hdr[0])
+	if mode != ModeCBC && mode != ModeCTR {
+		return nil, errors.New("Unsupported mode.")
+	}
+	blk, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	baseIV := make([]byte, aes.BlockSize)
+	copy(baseIV, hdr[1:])
+	return &AESRandomReader{ra: ra, mode: mode, block: blk, baseIV: baseIV, dataOff: int64(len(hdr))}, nil
+}
+
+/**
+ * Adds n to a big-endian 16-byte counter block, matching the way
+ * crypto/cipher's CTR implementation advances the IV one block at a
+ * time, so seeking can jump the counter straight to any block index.
+ */
+func addCounter(iv []byte, n int64) []byte {
+	c := new(big.Int).SetBytes(iv)
+	c.Add(c, big.NewInt(n))
+	out := c.Bytes()
+	res := make([]byte, aes.BlockSize)
+	copy(res[aes.BlockSize-len(out):], out)
+	return res
+}
+
+/**
+ * Decrypts the range [off, off+len(p)) of a CTR-mode stream. Since CTR
+ * is a stream cipher keyed by a counter, this seeks straight to the
+ * target block's counter value rather than decrypting from the start.
+ */
+func (r *AESRandomReader) readAtCTR(p []byte, off int64) (int, error) {
+	blockOff := off / aes.BlockSize
+	skip := int(off % aes.BlockSize)
+	iv := addCounter(r.baseIV, blockOff)
+	stream := cipher.NewCTR(r.block, iv)
+	buf := make([]byte, skip+len(p))
+	n, err := r.ra.ReadAt(buf, r.dataOff+blockOff*aes.BlockSize)
+	if n > skip {
+		stream.XORKeyStream(buf[0:n], buf[0:n])
+		n = copy(p, buf[skip:n])
+	} else {
+		n = 0
+	}
+	return n, err
+}
+
+/**
+ * Decrypts the range [off, off+len(p)) of a CBC-mode stream by reading
+ * the ciphertext block that precedes the target block and using it as
+ * the IV for cipher.NewCBCDecrypter.
+ */
+func (r *AESRandomReader) readAtCBC(p []byte, off int64) (int, error) {
+	blockOff := off / aes.BlockSize
+	skip := int(off % aes.BlockSize)
+	nBlocks := (skip+len(p)+aes.BlockSize-1)/aes.BlockSize + 1 //+1 for the IV block
+	buf := make([]byte, nBlocks*aes.BlockSize)
+	var readOff int64
+	if blockOff == 0 {
+		copy(buf[0:aes.BlockSize], r.baseIV)
+		n, err := r.ra.ReadAt(buf[aes.BlockSize:], r.dataOff)
+		n += aes.BlockSize
+		return r.finishCBC(p, buf, n, err, skip)
+	}
+	readOff = r.dataOff + (blockOff-1)*aes.BlockSize
+	n, err := r.ra.ReadAt(buf, readOff)
+	return r.finishCBC(p, buf, n, err, skip)
+}
+
+func (r *AESRandomReader) finishCBC(p, buf []byte, n int, err error, skip int) (int, error) {
+	//Only whole blocks beyond the IV can be decrypted
+	nCipher := ((n - aes.BlockSize) / aes.BlockSize) * aes.BlockSize
+	if nCipher <= 0 {
+		return 0, err
+	}
+	iv := buf[0:aes.BlockSize]
+	ciphertext := buf[aes.BlockSize : aes.BlockSize+nCipher]
+	mode := cipher.NewCBCDecrypter(r.block, iv)
+	mode.CryptBlocks(ciphertext, ciphertext)
+	if skip >= len(ciphertext) {
+		return 0, err
+	}
+	cp := copy(p, ciphertext[skip:])
+	if cp < len(p) {
+		return cp, err
+	}
+	return cp, nil
+}
+
+/**
+ * Implements io.ReaderAt, decrypting the requested range in place.
+ */
+func (r *AESRandomReader) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) <= 0 || off < 0 {
+		return 0, nil
+	}
+	switch r.mode {
+	case ModeCTR:
+		return r.readAtCTR(p, off)
+	default:
+		return r.readAtCBC(p, off)
+	}
+}
+
+/**
+ * Implements io.Seeker over the plaintext offset space so
+ * AESRandomReader can also be used as a sequential io.Reader.
+ */
+func (r *AESRandomReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		r.pos = offset
+	case io.SeekCurrent:
+		r.pos += offset
+	default:
+		return 0, errors.New("AESRandomReader does not support io.SeekEnd.")
+	}
+	if r.pos < 0 {
+		return 0, errors.New("Negative seek position.")
+	}
+	return r.pos, nil
+}
+
+/**
+ * Implements io.Reader, decrypting sequentially from the current
+ * Seek position and advancing it.
+ */
+func (r *AESRandomReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	return n, err
+}
@@ -0,0 +1,55 @@
+package aesrw
+
+import "bytes"
+import "math/rand"
+import "testing"
+
+//Test that AESRandomReader.ReadAt recovers arbitrary byte ranges of a
+//CTR-mode stream produced by EncryptMode
+func TestRandomReaderCTR(t *testing.T) {
+	k := RandomBytes(32)
+	plain := RandomBytes(500)
+	enc, err := EncryptMode(plain, k, ModeCTR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, err := NewRandomReader(bytes.NewReader(enc), k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		off := rand.Int63() % int64(len(plain))
+		n := 1 + rand.Int()%(len(plain)-int(off))
+		got := make([]byte, n)
+		if _, err := rr.ReadAt(got, off); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, plain[off:int(off)+n]) {
+			t.Error("Decrypted range does not match original data")
+		}
+	}
+}
+
+//Test that AESRandomReader.ReadAt recovers a block-aligned byte range
+//of a CBC-mode stream produced by EncryptMode
+func TestRandomReaderCBC(t *testing.T) {
+	k := RandomBytes(32)
+	//A multiple of the block size so block-aligned reads line up cleanly
+	plain := RandomBytes(8 * 16)
+	enc, err := EncryptMode(plain, k, ModeCBC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, err := NewRandomReader(bytes.NewReader(enc), k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	off := int64(3 * 16)
+	got := make([]byte, 2*16)
+	if _, err := rr.ReadAt(got, off); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain[off:off+2*16]) {
+		t.Error("Decrypted range does not match original data")
+	}
+}
@@ -0,0 +1,100 @@
+package aesrw
+
+import "bytes"
+import "io"
+import "testing"
+import "time"
+
+//chunkReader hands back at most max bytes per Read call regardless of
+//how large the caller's buffer is, simulating a slow network source.
+type chunkReader struct {
+	data []byte
+	pos  int
+	max  int
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if c.pos >= len(c.data) {
+		return 0, io.EOF
+	}
+	n := len(p)
+	if n > c.max {
+		n = c.max
+	}
+	if c.pos+n > len(c.data) {
+		n = len(c.data) - c.pos
+	}
+	copy(p, c.data[c.pos:c.pos+n])
+	c.pos += n
+	return n, nil
+}
+
+//Test that Read returns as soon as a chunk-limited source makes data
+//available, rather than blocking until the caller's (much larger)
+//buffer is filled
+func TestReadReturnsPromptlyOnPartialData(t *testing.T) {
+	k := RandomBytes(32)
+	plain := RandomBytes(500)
+	enc, err := Encrypt(plain, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := &chunkReader{data: enc, max: 40}
+	ar, err := NewReader(cr, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Buffer is far larger than a single 40-byte chunk of ciphertext
+	got := make([]byte, len(plain))
+	n, err := ar.Read(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 || n >= len(plain) {
+		t.Errorf("Expected a small, non-zero partial read; got n=%d", n)
+	}
+	if !bytes.Equal(got[0:n], plain[0:n]) {
+		t.Error("Partial read did not match the start of the original data")
+	}
+}
+
+//Test that Read returns with the data written so far over an io.Pipe
+//without waiting for data that hasn't been written yet
+func TestReadDoesNotStallOnPipe(t *testing.T) {
+	k := RandomBytes(32)
+	plain := RandomBytes(200)
+	enc, err := Encrypt(plain, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, pw := io.Pipe()
+	//Hold back everything after the first 48 bytes (IV + 2 ciphertext
+	//blocks) until the test has confirmed Read did not stall
+	release := make(chan struct{})
+	go func() {
+		pw.Write(enc[0:48])
+		<-release
+		pw.Write(enc[48:])
+		pw.Close()
+	}()
+	ar, err := NewReader(pr, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	var n int
+	go func() {
+		got := make([]byte, len(plain))
+		n, _ = ar.Read(got)
+		close(done)
+	}()
+	select {
+	case <-done:
+		if n == 0 {
+			t.Error("Read returned no data before the rest of the stream arrived")
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Read stalled waiting for data that had not been written yet")
+	}
+	close(release)
+}